@@ -0,0 +1,171 @@
+// MSF Big builder, the symmetric operation to the existing reader.
+//
+// ref: https://llvm.org/docs/PDB/MsfFile.html
+
+package pdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// fpm1PageNum and fpm2PageNum are the page numbers of the pair of alternating
+// free page map pages required at the start of an MSF Big file.
+const (
+	fpm1PageNum = 1
+	fpm2PageNum = 2
+)
+
+// Builder incrementally constructs a new PDB file, laying out added streams
+// into fixed-size pages of the MSF Big format and producing a valid
+// SuperBlock, the symmetric operation to ParseFile.
+//
+// ref: MsfBuilder
+type Builder struct {
+	// Page size in bytes.
+	pageSize int
+	// Contents of each stream, indexed by stream number.
+	streams [][]byte
+}
+
+// NewBuilder returns a new Builder that lays out streams into pages of the
+// given size.
+func NewBuilder(pageSize int) *Builder {
+	return &Builder{
+		pageSize: pageSize,
+	}
+}
+
+// AddStream appends a new stream with the given contents, returning the
+// stream number it was assigned.
+func (b *Builder) AddStream(data []byte) (int, error) {
+	streamNum := len(b.streams)
+	b.streams = append(b.streams, data)
+	return streamNum, nil
+}
+
+// ReplaceStream replaces the contents of the stream with the given stream
+// number.
+func (b *Builder) ReplaceStream(n int, data []byte) {
+	for len(b.streams) <= n {
+		b.streams = append(b.streams, nil)
+	}
+	b.streams[n] = data
+}
+
+// pageRange is a contiguous run of bytes laid out across one or more pages.
+type pageRange struct {
+	// Bytes to write, unpadded; the unused tail of the last page stays zero.
+	data []byte
+	// Page numbers holding data, in order.
+	pages []uint32
+}
+
+// Commit lays out the streams added to b into fixed-size pages and writes a
+// complete MSF Big PDB file to w.
+func (b *Builder) Commit(w io.Writer) error {
+	blockSize := b.pageSize
+	// Page 0 holds the SuperBlock; pages 1 and 2 hold the FPM1/FPM2 pair.
+	nextPage := uint32(3)
+	allocate := func(data []byte) []uint32 {
+		n := int(math.Ceil(float64(len(data)) / float64(blockSize)))
+		pages := make([]uint32, n)
+		for i := range pages {
+			pages[i] = nextPage
+			nextPage++
+		}
+		return pages
+	}
+
+	// Lay out stream data.
+	streamInfos := make([]StreamInfo, len(b.streams))
+	streamPages := make([][]uint32, len(b.streams))
+	var pageRanges []pageRange
+	for i, data := range b.streams {
+		streamInfos[i] = StreamInfo{Size: int32(len(data))}
+		pages := allocate(data)
+		streamPages[i] = pages
+		pageRanges = append(pageRanges, pageRange{data: data, pages: pages})
+	}
+
+	// Serialize the stream directory.
+	dirBuf := &bytes.Buffer{}
+	if err := binary.Write(dirBuf, binary.LittleEndian, uint32(len(b.streams))); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := binary.Write(dirBuf, binary.LittleEndian, streamInfos); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, pages := range streamPages {
+		if err := binary.Write(dirBuf, binary.LittleEndian, pages); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	dirData := dirBuf.Bytes()
+	dirPages := allocate(dirData)
+	pageRanges = append(pageRanges, pageRange{data: dirData, pages: dirPages})
+
+	// Serialize the directory-of-directory indirection block, listing the
+	// page numbers of the stream directory.
+	blockMapBuf := &bytes.Buffer{}
+	if err := binary.Write(blockMapBuf, binary.LittleEndian, dirPages); err != nil {
+		return errors.WithStack(err)
+	}
+	blockMapData := blockMapBuf.Bytes()
+	blockMapPages := allocate(blockMapData)
+	pageRanges = append(pageRanges, pageRange{data: blockMapData, pages: blockMapPages})
+	if len(blockMapPages) != 1 {
+		// TODO: support a stream directory large enough to require more than
+		// one level of indirection.
+		return errors.Errorf("stream directory too large: block map spans %d pages, want 1", len(blockMapPages))
+	}
+
+	numBlocks := nextPage
+	sb := &msfBigSuperBlock{
+		BlockSize:         uint32(blockSize),
+		FreeBlockMapBlock: fpm1PageNum,
+		NumBlocks:         numBlocks,
+		NumDirectoryBytes: uint32(len(dirData)),
+		BlockMapAddr:      blockMapPages[0],
+	}
+
+	buf := make([]byte, int(numBlocks)*blockSize)
+	copy(buf, []byte(msfBigSignature))
+	sbBuf := &bytes.Buffer{}
+	if err := binary.Write(sbBuf, binary.LittleEndian, sb); err != nil {
+		return errors.WithStack(err)
+	}
+	copy(buf[len(msfBigSignature):], sbBuf.Bytes())
+
+	// FPM1/FPM2: mark every allocated page as used (0), all others free (1).
+	fpm := make([]byte, blockSize)
+	for i := range fpm {
+		fpm[i] = 0xff
+	}
+	for page := uint32(0); page < numBlocks; page++ {
+		fpm[page/8] &^= 1 << (page % 8)
+	}
+	copy(buf[fpm1PageNum*blockSize:], fpm)
+	copy(buf[fpm2PageNum*blockSize:], fpm)
+
+	// Stream, directory, and block map pages.
+	for _, pr := range pageRanges {
+		for i, page := range pr.pages {
+			start := i * blockSize
+			end := start + blockSize
+			if end > len(pr.data) {
+				end = len(pr.data)
+			}
+			copy(buf[int(page)*blockSize:], pr.data[start:end])
+		}
+	}
+
+	if _, err := w.Write(buf); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package pdb
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestBuilderCommitRoundTrip verifies that a file produced by Builder.Commit
+// can be parsed back by ParseBytes, and that every stream's bytes match what
+// was added to the Builder.
+func TestBuilderCommitRoundTrip(t *testing.T) {
+	const pageSize = 512
+	b := NewBuilder(pageSize)
+
+	streams := [][]byte{
+		bytes.Repeat([]byte{0xAB}, 10),            // smaller than one page.
+		bytes.Repeat([]byte{0xCD}, pageSize),      // exactly one page.
+		bytes.Repeat([]byte{0xEF}, 3*pageSize+17), // spans multiple pages.
+		{}, // empty stream.
+	}
+	for i, data := range streams {
+		streamNum, err := b.AddStream(data)
+		if err != nil {
+			t.Fatalf("AddStream(%d) returned error: %v", i, err)
+		}
+		if streamNum != i {
+			t.Fatalf("AddStream(%d) = stream %d; want %d", i, streamNum, i)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := b.Commit(buf); err != nil {
+		t.Fatalf("Commit returned error: %v", err)
+	}
+
+	file, err := ParseBytes(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ParseBytes returned error: %v", err)
+	}
+	defer file.Close()
+
+	if got, want := int(file.StreamTbl.NStreams), len(streams); got != want {
+		t.Fatalf("NStreams = %d; want %d", got, want)
+	}
+	for i, want := range streams {
+		got := file.readStreamData(i)
+		if !bytes.Equal(got, want) {
+			t.Errorf("stream %d: readStreamData = %d bytes; want %d bytes matching the data added to the Builder", i, len(got), len(want))
+		}
+	}
+}
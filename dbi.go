@@ -0,0 +1,390 @@
+// DBI (debug information) stream.
+//
+// ref: https://llvm.org/docs/PDB/DbiStream.html
+
+package pdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// scVer60 is the version tag of the Section Contribution substream, as used
+// by modern MSVC toolchains.
+//
+// ref: DBISCImpv
+const scVer60 = 0xeffe0000 + 19
+
+// DbiStreamHeader is the header of the DBI stream.
+//
+// ref: https://llvm.org/docs/PDB/DbiStream.html#stream-header
+// ref: NewDBIHdr
+type DbiStreamHeader struct {
+	// DBI stream version signature; always -1.
+	VersionSignature int32
+	// DBI stream version.
+	VersionHeader uint32
+	// Age of the DBI stream, matching the age in the PDB stream.
+	Age uint32
+	// Stream number of the global symbol stream.
+	GlobalStreamIndex uint16
+	// Build number of the toolchain that produced the PDB.
+	BuildNumber uint16
+	// Stream number of the public symbol stream.
+	PublicStreamIndex uint16
+	// Version of mspdb*.dll that produced the PDB.
+	PdbDllVersion uint16
+	// Stream number holding all symbol records used by the global and public
+	// symbol streams.
+	SymRecordStream uint16
+	// Rebuild number of mspdb*.dll that produced the PDB.
+	PdbDllRbld uint16
+	// Size in bytes of the ModInfo substream.
+	ModInfoSize int32
+	// Size in bytes of the Section Contribution substream.
+	SectionContributionSize int32
+	// Size in bytes of the Section Map substream.
+	SectionMapSize int32
+	// Size in bytes of the File Info substream.
+	SourceInfoSize int32
+	// Size in bytes of the TypeServer Map substream.
+	TypeServerSize int32
+	// Index of the MFC type server in the TypeServer Map substream.
+	MFCTypeServerIndex uint32
+	// Size in bytes of the Optional Debug Header substream.
+	OptionalDbgHeaderSize int32
+	// Size in bytes of the EC substream.
+	ECSubstreamSize int32
+	// DBI stream flags.
+	Flags uint16
+	// Machine type of the executable.
+	Machine uint16
+	// Reserved; always zero.
+	Reserved uint32
+}
+
+// SectionContribEntry describes the contribution of a compiland (module) to
+// an image section.
+//
+// ref: SC
+type SectionContribEntry struct {
+	// Index of the section (1-based).
+	Section uint16
+	// Padding; unused.
+	Padding1 uint16
+	// Offset into the section.
+	Offset int32
+	// Size in bytes of the contribution.
+	Size int32
+	// Section characteristics (IMAGE_SCN_* flags).
+	Characteristics uint32
+	// Index of the contributing module.
+	ModuleIndex uint16
+	// Padding; unused.
+	Padding2 uint16
+	// CRC of the contributed data.
+	DataCrc uint32
+	// CRC of the relocations affecting the contributed data.
+	RelocCrc uint32
+}
+
+// ModInfo holds the symbol and line number information of a single compiland
+// (module).
+//
+// ref: MODI
+type ModInfo struct {
+	// Unused; always zero on disk.
+	Unused1 uint32
+	// Section contribution of this module.
+	SectionContrib SectionContribEntry
+	// Module flags.
+	Flags uint16
+	// Stream number holding the module's own symbols and line numbers, or
+	// 0xFFFF if the module has no private symbol stream.
+	ModuleSymStream uint16
+	// Size in bytes of the symbol data within ModuleSymStream.
+	SymBytes uint32
+	// Size in bytes of the C11 line number data within ModuleSymStream.
+	LineBytes uint32
+	// Size in bytes of the C13 line number data within ModuleSymStream.
+	C13Bytes uint32
+	// Number of source files contributing to this module.
+	NumFiles uint16
+	// Unused; always zero on disk.
+	Unused2 uint32
+	// Index into the File Info substream's name buffer of the module's
+	// primary source file name.
+	SourceFileNameIndex uint32
+	// Index into the File Info substream's name buffer of the module's PDB
+	// file path.
+	PdbFilePathNameIndex uint32
+	// Path of the module's source file.
+	ModuleName string
+	// Path of the module's object file.
+	ObjFileName string
+}
+
+// parseModInfos parses the ModInfo substream, reading from data.
+func parseModInfos(data []byte) ([]ModInfo, error) {
+	var mods []ModInfo
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		start := r.Len()
+		mod := ModInfo{}
+		if err := binary.Read(r, binary.LittleEndian, &mod.Unused1); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &mod.SectionContrib); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &mod.Flags); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &mod.ModuleSymStream); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &mod.SymBytes); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &mod.LineBytes); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &mod.C13Bytes); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &mod.NumFiles); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		var padding [2]byte
+		if err := binary.Read(r, binary.LittleEndian, &padding); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &mod.Unused2); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &mod.SourceFileNameIndex); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &mod.PdbFilePathNameIndex); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		moduleName, err := readCString(r)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		mod.ModuleName = moduleName
+		objFileName, err := readCString(r)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		mod.ObjFileName = objFileName
+		// Records are 4-byte aligned.
+		if n := start - r.Len(); n%4 != 0 {
+			if _, err := r.Seek(int64(4-n%4), io.SeekCurrent); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+		mods = append(mods, mod)
+	}
+	return mods, nil
+}
+
+// readCString reads a NUL-terminated string from r.
+func readCString(r *bytes.Reader) (string, error) {
+	var buf []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		if b == 0 {
+			break
+		}
+		buf = append(buf, b)
+	}
+	return string(buf), nil
+}
+
+// SectionContribs is the Section Contribution substream of the DBI stream.
+//
+// ref: https://llvm.org/docs/PDB/DbiStream.html#section-contribution-substream
+type SectionContribs struct {
+	// Version of the substream; Ver60 for modern PDBs.
+	Version uint32
+	// Section contribution of each module.
+	Entries []SectionContribEntry
+}
+
+// parseSectionContribs parses the Section Contribution substream, reading
+// from data.
+func parseSectionContribs(data []byte) (*SectionContribs, error) {
+	sc := &SectionContribs{}
+	r := bytes.NewReader(data)
+	if r.Len() == 0 {
+		return sc, nil
+	}
+	if err := binary.Read(r, binary.LittleEndian, &sc.Version); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for r.Len() > 0 {
+		entry := SectionContribEntry{}
+		if err := binary.Read(r, binary.LittleEndian, &entry); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		sc.Entries = append(sc.Entries, entry)
+	}
+	return sc, nil
+}
+
+// OptionalDbgHeader holds stream indices of miscellaneous auxiliary debug
+// information. A stream index of -1 indicates that the given stream is not
+// present. PDBs may omit trailing slots; a field past the end of the
+// on-disk substream is left at its zero value.
+//
+// ref: https://llvm.org/docs/PDB/DbiStream.html#optional-debug-header-stream
+type OptionalDbgHeader struct {
+	FPO            int16
+	Exception      int16
+	Fixup          int16
+	OmapToSrc      int16
+	OmapFromSrc    int16
+	SectionHdr     int16
+	TokenRidMap    int16
+	Xdata          int16
+	Pdata          int16
+	NewFPO         int16
+	SectionHdrOrig int16
+}
+
+// parseOptionalDbgHeader parses the Optional Debug Header substream, reading
+// from data. The substream holds up to 11 stream-index slots; decode however
+// many fit in data, leaving the remaining fields at their zero value.
+func parseOptionalDbgHeader(data []byte) (*OptionalDbgHeader, error) {
+	dbgHdr := &OptionalDbgHeader{}
+	fields := []*int16{
+		&dbgHdr.FPO,
+		&dbgHdr.Exception,
+		&dbgHdr.Fixup,
+		&dbgHdr.OmapToSrc,
+		&dbgHdr.OmapFromSrc,
+		&dbgHdr.SectionHdr,
+		&dbgHdr.TokenRidMap,
+		&dbgHdr.Xdata,
+		&dbgHdr.Pdata,
+		&dbgHdr.NewFPO,
+		&dbgHdr.SectionHdrOrig,
+	}
+	r := bytes.NewReader(data)
+	for _, field := range fields {
+		if r.Len() < 2 {
+			break
+		}
+		if err := binary.Read(r, binary.LittleEndian, field); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return dbgHdr, nil
+}
+
+// DBIStream is the DBI (debug information) stream of a PDB file. It holds the
+// list of compilands (modules), their section contributions, and (for modern
+// PDBs) auxiliary debug information streams.
+//
+// ref: https://llvm.org/docs/PDB/DbiStream.html
+type DBIStream struct {
+	// DBI stream header.
+	Header *DbiStreamHeader
+
+	modules           []ModInfo
+	sectionContribs   *SectionContribs
+	sectionMap        []byte // TODO: decode Section Map substream.
+	fileInfo          []byte // TODO: decode File Info substream.
+	typeServerMap     []byte // TODO: decode TypeServer Map substream.
+	ecSubstream       []byte // TODO: decode EC substream.
+	optionalDbgHeader *OptionalDbgHeader
+}
+
+// Modules returns the compilands (modules) described by the DBI stream.
+func (dbi *DBIStream) Modules() []ModInfo {
+	return dbi.modules
+}
+
+// SectionContribs returns the section contributions of each module, as
+// described by the DBI stream.
+func (dbi *DBIStream) SectionContribs() *SectionContribs {
+	return dbi.sectionContribs
+}
+
+// OptionalDbgHeader returns the optional debug header of the DBI stream, or
+// nil if not present.
+func (dbi *DBIStream) OptionalDbgHeader() *OptionalDbgHeader {
+	return dbi.optionalDbgHeader
+}
+
+// parseDBIStream parses the DBI stream, reading from r.
+func (file *File) parseDBIStream(r io.Reader) (*DBIStream, error) {
+	// DbiStreamHeader.
+	hdr := &DbiStreamHeader{}
+	if err := binary.Read(r, binary.LittleEndian, hdr); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	dbi := &DBIStream{
+		Header: hdr,
+	}
+	// ModInfo substream.
+	modInfoData := make([]byte, hdr.ModInfoSize)
+	if _, err := io.ReadFull(r, modInfoData); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	modules, err := parseModInfos(modInfoData)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	dbi.modules = modules
+	// Section Contribution substream.
+	sectionContribData := make([]byte, hdr.SectionContributionSize)
+	if _, err := io.ReadFull(r, sectionContribData); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	sectionContribs, err := parseSectionContribs(sectionContribData)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	dbi.sectionContribs = sectionContribs
+	// Section Map substream.
+	dbi.sectionMap = make([]byte, hdr.SectionMapSize)
+	if _, err := io.ReadFull(r, dbi.sectionMap); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// File Info substream.
+	dbi.fileInfo = make([]byte, hdr.SourceInfoSize)
+	if _, err := io.ReadFull(r, dbi.fileInfo); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// TypeServer Map substream.
+	dbi.typeServerMap = make([]byte, hdr.TypeServerSize)
+	if _, err := io.ReadFull(r, dbi.typeServerMap); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// EC substream.
+	dbi.ecSubstream = make([]byte, hdr.ECSubstreamSize)
+	if _, err := io.ReadFull(r, dbi.ecSubstream); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// Optional Debug Header substream.
+	if hdr.OptionalDbgHeaderSize > 0 {
+		dbgHdrData := make([]byte, hdr.OptionalDbgHeaderSize)
+		if _, err := io.ReadFull(r, dbgHdrData); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		dbgHdr, err := parseOptionalDbgHeader(dbgHdrData)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		dbi.optionalDbgHeader = dbgHdr
+	}
+	return dbi, nil
+}
@@ -0,0 +1,118 @@
+package pdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// buildModInfo serializes a single ModInfo record in its on-disk form,
+// 4-byte aligned, as expected by parseModInfos.
+func buildModInfo(t *testing.T, moduleSymStream uint16, moduleName, objFileName string) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, uint32(0))             // Unused1
+	binary.Write(buf, binary.LittleEndian, SectionContribEntry{}) // SectionContrib
+	binary.Write(buf, binary.LittleEndian, uint16(0))             // Flags
+	binary.Write(buf, binary.LittleEndian, moduleSymStream)       // ModuleSymStream
+	binary.Write(buf, binary.LittleEndian, uint32(0))             // SymBytes
+	binary.Write(buf, binary.LittleEndian, uint32(0))             // LineBytes
+	binary.Write(buf, binary.LittleEndian, uint32(0))             // C13Bytes
+	binary.Write(buf, binary.LittleEndian, uint16(0))             // NumFiles
+	binary.Write(buf, binary.LittleEndian, [2]byte{})             // padding
+	binary.Write(buf, binary.LittleEndian, uint32(0))             // Unused2
+	binary.Write(buf, binary.LittleEndian, uint32(0))             // SourceFileNameIndex
+	binary.Write(buf, binary.LittleEndian, uint32(0))             // PdbFilePathNameIndex
+	buf.WriteString(moduleName)
+	buf.WriteByte(0)
+	buf.WriteString(objFileName)
+	buf.WriteByte(0)
+	for buf.Len()%4 != 0 {
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+// TestParseDBIStreamRealHeaderLayout builds a DBI stream using the real
+// 64-byte on-disk DbiStreamHeader layout and verifies the header, ModInfo
+// substream, and a partial (10-entry) Optional Debug Header substream are
+// all parsed at the correct offsets.
+func TestParseDBIStreamRealHeaderLayout(t *testing.T) {
+	modInfoData := buildModInfo(t, 7, "foo.cpp", "foo.obj")
+
+	// Optional Debug Header substream with only 10 of the 11 slots present,
+	// as produced by some real-world PDBs.
+	optDbgData := &bytes.Buffer{}
+	for i := int16(0); i < 10; i++ {
+		binary.Write(optDbgData, binary.LittleEndian, i)
+	}
+
+	hdr := DbiStreamHeader{
+		VersionSignature:        -1,
+		VersionHeader:           19990903, // DBIImpvV70
+		Age:                     1,
+		GlobalStreamIndex:       5,
+		BuildNumber:             0x8eb0,
+		PublicStreamIndex:       6,
+		PdbDllVersion:           0,
+		SymRecordStream:         7,
+		PdbDllRbld:              0,
+		ModInfoSize:             int32(len(modInfoData)),
+		SectionContributionSize: 0,
+		SectionMapSize:          0,
+		SourceInfoSize:          0,
+		TypeServerSize:          0,
+		MFCTypeServerIndex:      0,
+		OptionalDbgHeaderSize:   int32(optDbgData.Len()),
+		ECSubstreamSize:         0,
+		Flags:                   0,
+		Machine:                 0x8664,
+		Reserved:                0,
+	}
+
+	buf := &bytes.Buffer{}
+	if err := binary.Write(buf, binary.LittleEndian, hdr); err != nil {
+		t.Fatalf("failed to write DbiStreamHeader: %v", err)
+	}
+	if got, want := buf.Len(), 64; got != want {
+		t.Fatalf("sizeof(DbiStreamHeader) = %d; want %d", got, want)
+	}
+	buf.Write(modInfoData)
+	buf.Write(optDbgData.Bytes())
+
+	file := &File{}
+	dbi, err := file.parseDBIStream(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("parseDBIStream returned error: %v", err)
+	}
+
+	if got, want := *dbi.Header, hdr; got != want {
+		t.Fatalf("Header = %+v; want %+v", got, want)
+	}
+	if got, want := len(dbi.Modules()), 1; got != want {
+		t.Fatalf("len(Modules()) = %d; want %d", got, want)
+	}
+	mod := dbi.Modules()[0]
+	if mod.ModuleSymStream != 7 {
+		t.Errorf("Modules()[0].ModuleSymStream = %d; want 7", mod.ModuleSymStream)
+	}
+	if mod.ModuleName != "foo.cpp" {
+		t.Errorf("Modules()[0].ModuleName = %q; want %q", mod.ModuleName, "foo.cpp")
+	}
+	if mod.ObjFileName != "foo.obj" {
+		t.Errorf("Modules()[0].ObjFileName = %q; want %q", mod.ObjFileName, "foo.obj")
+	}
+
+	dbgHdr := dbi.OptionalDbgHeader()
+	if dbgHdr == nil {
+		t.Fatal("OptionalDbgHeader() = nil; want non-nil")
+	}
+	want := OptionalDbgHeader{
+		FPO: 0, Exception: 1, Fixup: 2, OmapToSrc: 3, OmapFromSrc: 4,
+		SectionHdr: 5, TokenRidMap: 6, Xdata: 7, Pdata: 8, NewFPO: 9,
+		SectionHdrOrig: 0, // absent from the 10-entry substream; left zero.
+	}
+	if *dbgHdr != want {
+		t.Fatalf("OptionalDbgHeader() = %+v; want %+v", *dbgHdr, want)
+	}
+}
@@ -0,0 +1,86 @@
+// Mapped block stream: a view of a stream's pages that reads lazily from the
+// underlying MSF, without materializing the whole stream.
+
+package pdb
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// MappedBlockStream implements io.ReaderAt and io.Reader over a single
+// stream's pages, translating logical stream offsets into (page,
+// offsetInPage) reads against the underlying MSF source.
+//
+// ref: https://llvm.org/docs/PDB/MsfFile.html#mapped-streams
+type MappedBlockStream struct {
+	// Underlying source of the MSF.
+	r io.ReaderAt
+	// Page size in bytes.
+	pageSize int
+	// Page numbers of the stream, in order.
+	pages []uint32
+	// Size in bytes of the stream.
+	size int64
+	// Current offset, used by Read.
+	pos int64
+}
+
+// NewMappedBlockStream returns a stream over the given pages of r, each
+// pageSize bytes, truncated to size bytes.
+func NewMappedBlockStream(r io.ReaderAt, pageSize int, pages []uint32, size int64) *MappedBlockStream {
+	return &MappedBlockStream{
+		r:        r,
+		pageSize: pageSize,
+		pages:    pages,
+		size:     size,
+	}
+}
+
+// ReadAt implements io.ReaderAt, translating the logical offset off into the
+// underlying page(s) of the stream.
+func (s *MappedBlockStream) ReadAt(p []byte, off int64) (int, error) {
+	if off >= s.size {
+		return 0, io.EOF
+	}
+	// A read that runs past the end of the stream returns io.EOF along with
+	// the bytes that were available, as io.ReaderAt requires.
+	var eof error
+	if off+int64(len(p)) > s.size {
+		p = p[:s.size-off]
+		eof = io.EOF
+	}
+	var n int
+	for len(p) > 0 {
+		page := int(off / int64(s.pageSize))
+		offInPage := off % int64(s.pageSize)
+		if page >= len(s.pages) {
+			return n, io.ErrUnexpectedEOF
+		}
+		pageOffset := int64(s.pages[page])*int64(s.pageSize) + offInPage
+		nRead := int64(s.pageSize) - offInPage
+		if nRead > int64(len(p)) {
+			nRead = int64(len(p))
+		}
+		m, err := s.r.ReadAt(p[:nRead], pageOffset)
+		n += m
+		if err != nil && err != io.EOF {
+			return n, errors.WithStack(err)
+		}
+		if int64(m) < nRead {
+			return n, io.ErrUnexpectedEOF
+		}
+		p = p[nRead:]
+		off += nRead
+	}
+	return n, eof
+}
+
+// Read implements io.Reader, reading sequentially from the stream's current
+// position.
+func (s *MappedBlockStream) Read(p []byte) (int, error) {
+	n, err := s.ReadAt(p, s.pos)
+	s.pos += int64(n)
+	return n, err
+}
@@ -8,11 +8,11 @@
 package pdb
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/binary"
 	"encoding/hex"
 	"io"
-	"io/ioutil"
 	"log"
 	"math"
 	"os"
@@ -30,6 +30,12 @@ var (
 	warn = log.New(os.Stderr, term.RedBold("pdb:")+" ", 0)
 )
 
+// Verbose controls whether parseStream logs a hex dump of each stream it
+// decodes. It is off by default, since dumping every stream of a real PDB is
+// prohibitively verbose and would defeat the purpose of reading streams
+// lazily.
+var Verbose bool
+
 // From https://github.com/microsoft/microsoft-pdb
 //
 //    +============+==============================+=====================================================================+
@@ -46,7 +52,8 @@ var (
 //    | n+7        | Type hash                    | Hash used by the TPI stream.                                        |
 //    +------------+------------------------------+---------------------------------------------------------------------+
 
-// File is a PDB file.
+// File is a PDB file. Stream contents are read on demand from the underlying
+// source; call Close once done, if the File was returned by ParseFile.
 type File struct {
 	// File header of MSF.
 	FileHdr *MSFHeader
@@ -57,26 +64,57 @@ type File struct {
 	// Streams.
 	Streams []Stream
 
-	// Contents of underlying PDB file.
-	Data []byte // TODO: rename to buf
+	// Underlying source of the PDB file, read a page at a time.
+	r io.ReaderAt
+	// Non-nil if r was opened by ParseFile, and should be closed with the
+	// File.
+	closer io.Closer
 }
 
-// ParseFile parses the given PDB file, reading from pdbPath.
+// ParseFile parses the given PDB file, reading from pdbPath. Pages are read
+// lazily from pdbPath as needed; call Close when done with the returned File.
 func ParseFile(pdbPath string) (*File, error) {
-	// Read PDB file contents.
-	buf, err := ioutil.ReadFile(pdbPath)
+	f, err := os.Open(pdbPath)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	file, err := parse(f)
 	if err != nil {
+		f.Close()
 		return nil, errors.WithStack(err)
 	}
+	file.closer = f
+	return file, nil
+}
+
+// ParseBytes parses a PDB file already held in memory by buf.
+func ParseBytes(buf []byte) (*File, error) {
+	return parse(bytes.NewReader(buf))
+}
+
+// parse parses a PDB file, reading pages on demand from r.
+func parse(r io.ReaderAt) (*File, error) {
 	file := &File{
-		Data: buf,
+		r: r,
 	}
 	// Parse MSF file header.
-	msfHdr, err := parseMSFHeader(bytes.NewReader(file.Data))
+	msfHdr, err := parseMSFHeader(io.NewSectionReader(r, 0, math.MaxInt64))
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 	file.FileHdr = msfHdr
+	// For MSF Big, the stream table page numbers are not stored inline in the
+	// header, but reached through one level of indirection: BlockMapAddr points
+	// to a page holding the (32-bit) page numbers of the stream table.
+	if msfHdr.Version == MSFVersionBig {
+		streamTblNPages := int(math.Ceil(float64(msfHdr.StreamTblInfo.Size) / float64(msfHdr.PageSize)))
+		blockMapPage := file.readPage(int(msfHdr.BlockMapAddr))
+		pageNumMap := make([]uint32, streamTblNPages)
+		if err := binary.Read(bytes.NewReader(blockMapPage), binary.LittleEndian, &pageNumMap); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		msfHdr.PageNumMap = pageNumMap
+	}
 	// Parse free page map.
 	freePageMapData := file.readPage(int(file.FileHdr.FreePageMapPageNum))
 	file.FreePageMap = &FreePageMap{
@@ -96,18 +134,45 @@ func ParseFile(pdbPath string) (*File, error) {
 	return file, nil
 }
 
-// readPage returns the contents of the given page.
+// Close closes the underlying PDB file, if it was opened by ParseFile.
+func (file *File) Close() error {
+	if file.closer != nil {
+		return errors.WithStack(file.closer.Close())
+	}
+	return nil
+}
+
+// readPage returns the contents of the given page, read from the underlying
+// source.
 func (file *File) readPage(pageNum int) []byte {
 	pageSize := int(file.FileHdr.PageSize)
-	start := pageNum * pageSize
-	end := start + pageSize
-	return file.Data[start:end]
+	buf := make([]byte, pageSize)
+	offset := int64(pageNum) * int64(pageSize)
+	if _, err := file.r.ReadAt(buf, offset); err != nil && err != io.EOF {
+		warn.Printf("failed to read page %d: %v", pageNum, err)
+	}
+	return buf
 }
 
 // MSF signatures.
 const (
+	// msfSignature is the signature of the MSF Small (2.00) SuperBlock.
 	msfSignature = "Microsoft C/C++ program database 2.00\r\n\x1a\x4a\x47\x00\x00"
-	// TODO: define signature for MSFBig.
+	// msfBigSignature is the signature of the MSF Big (7.00) SuperBlock, as
+	// produced by modern MSVC toolchains.
+	msfBigSignature = "Microsoft C/C++ MSF 7.00\r\n\x1a\x44\x53\x00\x00\x00"
+)
+
+// MSFVersion identifies the on-disk layout of the MSF SuperBlock.
+type MSFVersion int
+
+// MSF SuperBlock versions.
+const (
+	// MSFVersionSmall is the original MSF ("2.00") format, with 16-bit page
+	// numbers.
+	MSFVersionSmall MSFVersion = iota
+	// MSFVersionBig is the MSF Big ("7.00") format, with 32-bit page numbers.
+	MSFVersionBig
 )
 
 // MSFHeader is the header of a multistream file (MSF). The MSF header is always
@@ -116,58 +181,137 @@ const (
 // ref: https://llvm.org/docs/PDB/MsfFile.html#the-superblock
 // ref: MSF_HDR
 type MSFHeader struct {
+	// MSF SuperBlock version.
+	Version MSFVersion
 	// File format identifier.
-	Magic [44]byte
+	Magic []byte
 	// Page size in bytes.
 	PageSize int32
 	// Page number of free page map.
-	FreePageMapPageNum uint16
+	FreePageMapPageNum uint32
 	// Number of pages.
-	NPages uint16
+	NPages uint32
 	// Stream information about the stream table.
 	StreamTblInfo StreamInfo
+	// Page number of the page holding the (32-bit) page numbers of the stream
+	// table. Only used by MSF Big, where the stream table is reached through
+	// one level of indirection; zero for MSF Small, where PageNumMap is stored
+	// inline after the header.
+	BlockMapAddr uint32
 	// Maps from stream page number to page number.
-	PageNumMap []uint16 // length: math.Ceil(msfHdr.StreamTblInfo.Size / msfHdr.PageSize)
+	PageNumMap []uint32 // length: math.Ceil(msfHdr.StreamTblInfo.Size / msfHdr.PageSize)
 	// align until page boundry.
 }
 
-// parseMSFHeader parses the given MSF file header, reading from r.
+// parseMSFHeader parses the given MSF file header, reading from r, dispatching
+// on the MSF Small and MSF Big signatures.
 func parseMSFHeader(r io.Reader) (*MSFHeader, error) {
+	br := bufio.NewReader(r)
+	bigMagic, err := br.Peek(len(msfBigSignature))
+	if err == nil && string(bigMagic) == msfBigSignature {
+		return parseMSFBigHeader(br)
+	}
+	return parseMSFSmallHeader(br)
+}
+
+// parseMSFSmallHeader parses the given MSF Small (2.00) file header, reading
+// from r.
+func parseMSFSmallHeader(r io.Reader) (*MSFHeader, error) {
 	// Magic.
-	msfHdr := &MSFHeader{}
-	if err := binary.Read(r, binary.LittleEndian, &msfHdr.Magic); err != nil {
+	var magic [44]byte
+	if err := binary.Read(r, binary.LittleEndian, &magic); err != nil {
 		return nil, errors.WithStack(err)
 	}
-	magic := string(msfHdr.Magic[:])
-	if magic != msfSignature {
-		return nil, errors.Errorf("invalid MSF signature; expected %q, got %q", msfSignature, magic)
+	if string(magic[:]) != msfSignature {
+		return nil, errors.Errorf("invalid MSF signature; expected %q or %q, got %q", msfSignature, msfBigSignature, magic[:])
+	}
+	msfHdr := &MSFHeader{
+		Version: MSFVersionSmall,
+		Magic:   append([]byte{}, magic[:]...),
 	}
 	// PageSize.
 	if err := binary.Read(r, binary.LittleEndian, &msfHdr.PageSize); err != nil {
 		return nil, errors.WithStack(err)
 	}
 	// FreePageMapPageNum.
-	if err := binary.Read(r, binary.LittleEndian, &msfHdr.FreePageMapPageNum); err != nil {
+	var freePageMapPageNum uint16
+	if err := binary.Read(r, binary.LittleEndian, &freePageMapPageNum); err != nil {
 		return nil, errors.WithStack(err)
 	}
+	msfHdr.FreePageMapPageNum = uint32(freePageMapPageNum)
 	// NPages.
-	if err := binary.Read(r, binary.LittleEndian, &msfHdr.NPages); err != nil {
+	var nPages uint16
+	if err := binary.Read(r, binary.LittleEndian, &nPages); err != nil {
 		return nil, errors.WithStack(err)
 	}
+	msfHdr.NPages = uint32(nPages)
 	// StreamTblInfo.
 	if err := binary.Read(r, binary.LittleEndian, &msfHdr.StreamTblInfo); err != nil {
 		return nil, errors.WithStack(err)
 	}
 	// PageNumMap.
 	streamTblNPages := int(math.Ceil(float64(msfHdr.StreamTblInfo.Size) / float64(msfHdr.PageSize))) // number of pages used by stream table.
-	msfHdr.PageNumMap = make([]uint16, streamTblNPages)
-	if err := binary.Read(r, binary.LittleEndian, &msfHdr.PageNumMap); err != nil {
+	pageNumMap := make([]uint16, streamTblNPages)
+	if err := binary.Read(r, binary.LittleEndian, &pageNumMap); err != nil {
 		return nil, errors.WithStack(err)
 	}
+	msfHdr.PageNumMap = make([]uint32, len(pageNumMap))
+	for i, pageNum := range pageNumMap {
+		msfHdr.PageNumMap[i] = uint32(pageNum)
+	}
 	// TODO: validate alignment until page boundry to be all zero?
 	return msfHdr, nil
 }
 
+// msfBigSuperBlock mirrors the on-disk layout of the MSF Big (7.00) SuperBlock
+// that follows the 32-byte magic.
+//
+// ref: https://llvm.org/docs/PDB/MsfFile.html#the-superblock
+type msfBigSuperBlock struct {
+	// Page size in bytes.
+	BlockSize uint32
+	// Page number of the free block map (one of a pair of alternating pages).
+	FreeBlockMapBlock uint32
+	// Number of pages in the file.
+	NumBlocks uint32
+	// Size in bytes of the stream table.
+	NumDirectoryBytes uint32
+	// Unknown; unused.
+	Unknown uint32
+	// Page number of the page holding the page numbers of the stream table.
+	BlockMapAddr uint32
+}
+
+// parseMSFBigHeader parses the given MSF Big (7.00) file header, reading from
+// r.
+func parseMSFBigHeader(r io.Reader) (*MSFHeader, error) {
+	// Magic.
+	var magic [32]byte
+	if err := binary.Read(r, binary.LittleEndian, &magic); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if string(magic[:]) != msfBigSignature {
+		return nil, errors.Errorf("invalid MSF Big signature; expected %q, got %q", msfBigSignature, magic[:])
+	}
+	// SuperBlock.
+	sb := &msfBigSuperBlock{}
+	if err := binary.Read(r, binary.LittleEndian, sb); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	msfHdr := &MSFHeader{
+		Version:            MSFVersionBig,
+		Magic:              append([]byte{}, magic[:]...),
+		PageSize:           int32(sb.BlockSize),
+		FreePageMapPageNum: sb.FreeBlockMapBlock,
+		NPages:             sb.NumBlocks,
+		StreamTblInfo: StreamInfo{
+			Size: int32(sb.NumDirectoryBytes),
+		},
+		BlockMapAddr: sb.BlockMapAddr,
+	}
+	return msfHdr, nil
+}
+
 // StreamInfo specifies stream information.
 //
 // ref: SI_PERSIST
@@ -229,20 +373,19 @@ type StreamTable struct {
 	// Maps from stream number and stream page number to page number. Note that
 	// the array is jagged, and as such, the length of the page number slices may
 	// differ.
-	PageNumMaps [][]uint16 // length of PageNumMaps[i]: math.Ceil(streamTbl.StreamInfos[i].Size / msfHdr.PageSize)
+	PageNumMaps [][]uint32 // length of PageNumMaps[i]: math.Ceil(streamTbl.StreamInfos[i].Size / msfHdr.PageSize)
 }
 
 // readStreamTable reads the contents of the stream table, concatenating its
 // pages together.
 func (file *File) readStreamTable() []byte {
 	streamTblNPages := int(math.Ceil(float64(file.FileHdr.StreamTblInfo.Size) / float64(file.FileHdr.PageSize))) // number of pages used by stream table.
-	var streamTblData []byte
-	for streamPageNum := 0; streamPageNum < streamTblNPages; streamPageNum++ {
-		pageNum := int(file.FileHdr.PageNumMap[streamPageNum])
-		pageData := file.readPage(pageNum)
-		streamTblData = append(streamTblData, pageData...)
+	stream := NewMappedBlockStream(file.r, int(file.FileHdr.PageSize), file.FileHdr.PageNumMap[:streamTblNPages], int64(file.FileHdr.StreamTblInfo.Size))
+	streamTblData := make([]byte, file.FileHdr.StreamTblInfo.Size)
+	if _, err := io.ReadFull(stream, streamTblData); err != nil {
+		warn.Printf("failed to read stream table: %v", err)
 	}
-	return streamTblData[:file.FileHdr.StreamTblInfo.Size]
+	return streamTblData
 }
 
 // parseStreamTable parses the given stream table, reading from r.
@@ -258,12 +401,24 @@ func (file *File) parseStreamTable(r io.Reader) (*StreamTable, error) {
 		return nil, errors.WithStack(err)
 	}
 	// PageNumMaps.
-	streamTbl.PageNumMaps = make([][]uint16, streamTbl.NStreams)
+	streamTbl.PageNumMaps = make([][]uint32, streamTbl.NStreams)
 	for i := range streamTbl.PageNumMaps {
 		streamNPages := int(math.Ceil(float64(streamTbl.StreamInfos[i].Size) / float64(file.FileHdr.PageSize)))
-		streamTbl.PageNumMaps[i] = make([]uint16, streamNPages)
-		if err := binary.Read(r, binary.LittleEndian, &streamTbl.PageNumMaps[i]); err != nil {
-			return nil, errors.WithStack(err)
+		switch file.FileHdr.Version {
+		case MSFVersionBig:
+			streamTbl.PageNumMaps[i] = make([]uint32, streamNPages)
+			if err := binary.Read(r, binary.LittleEndian, &streamTbl.PageNumMaps[i]); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		default:
+			pageNumMap := make([]uint16, streamNPages)
+			if err := binary.Read(r, binary.LittleEndian, &pageNumMap); err != nil {
+				return nil, errors.WithStack(err)
+			}
+			streamTbl.PageNumMaps[i] = make([]uint32, streamNPages)
+			for j, pageNum := range pageNumMap {
+				streamTbl.PageNumMaps[i][j] = uint32(pageNum)
+			}
 		}
 	}
 	return streamTbl, nil
@@ -275,6 +430,9 @@ type StreamID uint32
 // Fixed stream indices (fixed stream number).
 const (
 	StreamIDPDBStream StreamID = 1 // PDB stream
+	StreamIDTPIStream StreamID = 2 // TPI (type manager) stream
+	StreamIDDBIStream StreamID = 3 // DBI (debug information) stream
+	StreamIDIPIStream StreamID = 4 // IPI (ID manager) stream
 )
 
 // readStreamData reads the contents of the stream with the given stream number,
@@ -282,13 +440,23 @@ const (
 func (file *File) readStreamData(streamNum int) []byte {
 	streamInfo := file.StreamTbl.StreamInfos[streamNum]
 	pageNumMap := file.StreamTbl.PageNumMaps[streamNum]
-	var streamData []byte
-	for streamPageNum, pageNum := range pageNumMap {
-		_ = streamPageNum
-		pageData := file.readPage(int(pageNum))
-		streamData = append(streamData, pageData...)
+	stream := NewMappedBlockStream(file.r, int(file.FileHdr.PageSize), pageNumMap, int64(streamInfo.Size))
+	streamData := make([]byte, streamInfo.Size)
+	if _, err := io.ReadFull(stream, streamData); err != nil {
+		warn.Printf("failed to read stream %d: %v", streamNum, err)
 	}
-	return streamData[:streamInfo.Size]
+	return streamData
+}
+
+// readStreamDataVerbose reads the contents of the stream with the given
+// stream number, as readStreamData, additionally logging a hex dump of its
+// contents when Verbose is enabled.
+func (file *File) readStreamDataVerbose(streamNum int) []byte {
+	streamData := file.readStreamData(streamNum)
+	if Verbose {
+		dbg.Print("   streamData:\n", hex.Dump(streamData))
+	}
+	return streamData
 }
 
 // Stream is a stream of a PDB file.
@@ -296,25 +464,58 @@ func (file *File) readStreamData(streamNum int) []byte {
 // Stream is one of the following types.
 //
 //    *PDBStream
+//    *DBIStream
+//    *TPIStream
+//
 // TODO: add more stream types.
 type Stream interface{}
 
 // parseStream parses the stream with the given stream number.
 //
+// Stream numbers not handled by the switch below are skipped without reading
+// their data, since most streams of a real PDB (module, symbol and hash
+// streams) aren't decoded yet and reading them would defeat the purpose of
+// the lazily-paged MappedBlockStream.
+//
 // ref: https://llvm.org/docs/PDB/index.html#streams
 func (file *File) parseStream(streamNum int) error {
-	dbg.Println("parseStream")
-	dbg.Println("   streamNum:", streamNum)
-	streamData := file.readStreamData(streamNum)
-	dbg.Print("   streamData:\n", hex.Dump(streamData))
+	if Verbose {
+		dbg.Println("parseStream")
+		dbg.Println("   streamNum:", streamNum)
+	}
 	switch StreamID(streamNum) {
 	// PDB Stream
 	case StreamIDPDBStream:
+		streamData := file.readStreamDataVerbose(streamNum)
 		pdbStream, err := file.parsePDBStream(bytes.NewReader(streamData))
 		if err != nil {
 			return errors.WithStack(err)
 		}
 		file.Streams = append(file.Streams, pdbStream)
+	// TPI Stream
+	case StreamIDTPIStream:
+		streamData := file.readStreamDataVerbose(streamNum)
+		tpiStream, err := file.parseTPIStream(bytes.NewReader(streamData))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		file.Streams = append(file.Streams, tpiStream)
+	// DBI Stream
+	case StreamIDDBIStream:
+		streamData := file.readStreamDataVerbose(streamNum)
+		dbiStream, err := file.parseDBIStream(bytes.NewReader(streamData))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		file.Streams = append(file.Streams, dbiStream)
+	// IPI Stream
+	case StreamIDIPIStream:
+		streamData := file.readStreamDataVerbose(streamNum)
+		ipiStream, err := file.parseTPIStream(bytes.NewReader(streamData))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		file.Streams = append(file.Streams, ipiStream)
 	default:
 		warn.Printf("support for stream number %d not yet implemented", streamNum)
 	}
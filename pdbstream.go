@@ -0,0 +1,248 @@
+// PDB (header) stream.
+//
+// ref: https://llvm.org/docs/PDB/PdbStream.html
+
+package pdb
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// PDBStreamHeader is the header of the PDB stream.
+//
+// ref: https://llvm.org/docs/PDB/PdbStream.html#stream-header
+type PDBStreamHeader struct {
+	// PDB stream version.
+	Version int32
+	// Signature of the PDB stream, as a Unix timestamp.
+	Signature uint32
+	// Age of the PDB stream, incremented each time the PDB is written.
+	Age uint32
+	// Unique identifier of the PDB, matching the CodeView debug directory
+	// entry of the associated executable.
+	UniqueID [16]byte
+}
+
+// PDBStream is the PDB (header) stream of a PDB file. Besides the stream
+// header, it holds the NameMap, a table that maps from named stream (such as
+// "/names" or "/LinkInfo") to the backing stream number.
+//
+// ref: https://llvm.org/docs/PDB/PdbStream.html
+type PDBStream struct {
+	// PDB stream header.
+	Header *PDBStreamHeader
+	// Named-stream table.
+	NameMap *NameMap
+}
+
+// parsePDBStream parses the PDB stream, reading from r.
+func (file *File) parsePDBStream(r io.Reader) (*PDBStream, error) {
+	hdr := &PDBStreamHeader{}
+	if err := binary.Read(r, binary.LittleEndian, hdr); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	nameMap, err := parseNameMap(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	pdbStream := &PDBStream{
+		Header:  hdr,
+		NameMap: nameMap,
+	}
+	return pdbStream, nil
+}
+
+// nameMapEntry is a single (name, stream number) pair of the NameMap's hash
+// table, identified by the byte offset of the name into NameMap.Buffer.
+type nameMapEntry struct {
+	NameOffset uint32
+	StreamNum  uint32
+}
+
+// NameMap is the named-stream table trailing the PDB stream header. It maps
+// from stream name (e.g. "/names", "/LinkInfo", "/src/headerblock", or
+// "/TMCache") to stream number, through a sparse hash table keyed by the
+// LLVM PDB hash-V1 of the name.
+//
+// ref: https://llvm.org/docs/PDB/PdbStream.html#named-stream-map
+type NameMap struct {
+	// Buffer is the flat, concatenated sequence of NUL-terminated strings
+	// referenced by entries, indexed by byte offset.
+	Buffer []byte
+	// Capacity is the number of buckets in the hash table.
+	Capacity uint32
+
+	// present reports, for each bucket index, whether it holds an entry.
+	present map[uint32]bool
+	// deleted reports, for each bucket index, whether it held an entry that
+	// has since been removed. A probe sequence must continue past a deleted
+	// bucket (unlike a bucket that was never used) since a colliding entry
+	// may have been chained beyond it.
+	deleted map[uint32]bool
+	// entries holds the populated (nameOffset, streamNum) pairs, in the order
+	// they were written (ascending bucket index).
+	entries []nameMapEntry
+	// bucketEntry maps a populated bucket index to its position in entries.
+	bucketEntry map[uint32]int
+}
+
+// parseNameMap parses the NameMap, reading from r.
+func parseNameMap(r io.Reader) (*NameMap, error) {
+	// Names buffer.
+	var bufSize uint32
+	if err := binary.Read(r, binary.LittleEndian, &bufSize); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	buf := make([]byte, bufSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// Number of names (informational; matches the hash table's Size).
+	var count uint32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// HashTable<uint32,uint32>.
+	var size, capacity uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &capacity); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	present, err := readBitVector(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	deleted, err := readBitVector(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	nm := &NameMap{
+		Buffer:      buf,
+		Capacity:    capacity,
+		present:     present,
+		deleted:     deleted,
+		bucketEntry: make(map[uint32]int),
+	}
+	for bucket := uint32(0); bucket < capacity; bucket++ {
+		if !present[bucket] {
+			continue
+		}
+		entry := nameMapEntry{}
+		if err := binary.Read(r, binary.LittleEndian, &entry.NameOffset); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &entry.StreamNum); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		nm.bucketEntry[bucket] = len(nm.entries)
+		nm.entries = append(nm.entries, entry)
+	}
+	return nm, nil
+}
+
+// readBitVector reads a bitvector, reading from r: a uint32 word count,
+// followed by that many uint32 words, each bit of which identifies whether
+// the corresponding hash table bucket is populated.
+func readBitVector(r io.Reader) (map[uint32]bool, error) {
+	var nWords uint32
+	if err := binary.Read(r, binary.LittleEndian, &nWords); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	words := make([]uint32, nWords)
+	if err := binary.Read(r, binary.LittleEndian, &words); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	bits := make(map[uint32]bool)
+	for i, word := range words {
+		for bit := 0; bit < 32; bit++ {
+			if word&(1<<uint(bit)) != 0 {
+				bits[uint32(i*32+bit)] = true
+			}
+		}
+	}
+	return bits, nil
+}
+
+// Lookup returns the stream number of the named stream with the given name,
+// hashing name with the LLVM PDB hash-V1 and walking the hash table's probe
+// sequence starting at its home bucket. The probe continues past deleted
+// (tombstoned) buckets, stopping only at one that was never populated.
+func (nm *NameMap) Lookup(name string) (int, bool) {
+	if nm.Capacity == 0 {
+		return 0, false
+	}
+	start := hashV1(name) % nm.Capacity
+	for i := uint32(0); i < nm.Capacity; i++ {
+		bucket := (start + i) % nm.Capacity
+		if !nm.present[bucket] {
+			if !nm.deleted[bucket] {
+				return 0, false
+			}
+			continue
+		}
+		entry := nm.entries[nm.bucketEntry[bucket]]
+		if cStringAt(nm.Buffer, entry.NameOffset) == name {
+			return int(entry.StreamNum), true
+		}
+	}
+	return 0, false
+}
+
+// cStringAt returns the NUL-terminated string starting at the given byte
+// offset into buf.
+func cStringAt(buf []byte, offset uint32) string {
+	if int(offset) >= len(buf) {
+		return ""
+	}
+	end := int(offset)
+	for end < len(buf) && buf[end] != 0 {
+		end++
+	}
+	return string(buf[offset:end])
+}
+
+// hashV1 computes the LLVM PDB hash-V1 of s, as used to key the named-stream
+// hash table.
+//
+// ref: hashStringV1
+func hashV1(s string) uint32 {
+	var result uint32
+	buf := []byte(s)
+	for len(buf) >= 4 {
+		result ^= binary.LittleEndian.Uint32(buf)
+		buf = buf[4:]
+	}
+	if len(buf) >= 2 {
+		result ^= uint32(binary.LittleEndian.Uint16(buf))
+		buf = buf[2:]
+	}
+	if len(buf) == 1 {
+		result ^= uint32(buf[0])
+	}
+	const toLowerMask = 0x20202020
+	result |= toLowerMask
+	result ^= result >> 11
+	return result ^ (result >> 16)
+}
+
+// NamedStream returns the stream number of the named stream with the given
+// name (e.g. "/names", "/LinkInfo", "/src/headerblock", or "/TMCache"), as
+// resolved through the PDB stream's NameMap.
+func (file *File) NamedStream(name string) (int, bool) {
+	for _, stream := range file.Streams {
+		pdbStream, ok := stream.(*PDBStream)
+		if !ok {
+			continue
+		}
+		if pdbStream.NameMap == nil {
+			return 0, false
+		}
+		return pdbStream.NameMap.Lookup(name)
+	}
+	return 0, false
+}
@@ -0,0 +1,52 @@
+package pdb
+
+import "testing"
+
+// TestNameMapLookupProbesPastDeletedBucket verifies that Lookup continues
+// probing past a deleted (tombstoned) bucket, rather than stopping at it as
+// it would for a bucket that was never populated.
+func TestNameMapLookupProbesPastDeletedBucket(t *testing.T) {
+	// Find a name that hashes to bucket 0 of a 2-bucket table.
+	var name string
+	for _, cand := range []string{"C", "foo", "bar", "baz", "qux", "quux", "stream7", "abcde"} {
+		if hashV1(cand)%2 == 0 {
+			name = cand
+			break
+		}
+	}
+	if name == "" {
+		t.Fatal("could not find a candidate name hashing to bucket 0 mod 2")
+	}
+
+	// Bucket 0 was vacated by a deletion, so the entry for name collided
+	// into bucket 1 at insertion time.
+	nm := &NameMap{
+		Buffer:      append([]byte(name), 0),
+		Capacity:    2,
+		present:     map[uint32]bool{0: false, 1: true},
+		deleted:     map[uint32]bool{0: true, 1: false},
+		entries:     []nameMapEntry{{NameOffset: 0, StreamNum: 42}},
+		bucketEntry: map[uint32]int{1: 0},
+	}
+	streamNum, ok := nm.Lookup(name)
+	if !ok {
+		t.Fatalf("Lookup(%q) = _, false; want 42, true (entry is reachable at bucket 1 by probing past the deleted bucket 0)", name)
+	}
+	if streamNum != 42 {
+		t.Fatalf("Lookup(%q) = %d; want 42", name, streamNum)
+	}
+}
+
+// TestNameMapLookupStopsAtNeverUsedBucket verifies that Lookup still reports
+// a miss when the home bucket was never populated (as opposed to deleted).
+func TestNameMapLookupStopsAtNeverUsedBucket(t *testing.T) {
+	nm := &NameMap{
+		Capacity:    2,
+		present:     map[uint32]bool{0: false, 1: false},
+		deleted:     map[uint32]bool{},
+		bucketEntry: map[uint32]int{},
+	}
+	if _, ok := nm.Lookup("missing"); ok {
+		t.Fatal("Lookup(\"missing\") = _, true; want _, false")
+	}
+}
@@ -0,0 +1,640 @@
+// TPI (type manager) and IPI (ID manager) streams.
+//
+// ref: https://llvm.org/docs/PDB/TpiStream.html
+// ref: https://llvm.org/docs/PDB/CodeViewTypes.html
+
+package pdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// TypeLeafKind is the kind of a CodeView type (or ID) record.
+//
+// ref: LEAF_ENUM_e
+type TypeLeafKind uint16
+
+// CodeView type record kinds.
+//
+// ref: https://llvm.org/docs/PDB/CodeViewTypes.html
+const (
+	LF_MODIFIER  TypeLeafKind = 0x1001
+	LF_POINTER   TypeLeafKind = 0x1002
+	LF_PROCEDURE TypeLeafKind = 0x1008
+	LF_BCLASS    TypeLeafKind = 0x1400
+	LF_ARGLIST   TypeLeafKind = 0x1201
+	LF_FIELDLIST TypeLeafKind = 0x1203
+	LF_ENUMERATE TypeLeafKind = 0x1502
+	LF_ARRAY     TypeLeafKind = 0x1503
+	LF_CLASS     TypeLeafKind = 0x1504
+	LF_STRUCTURE TypeLeafKind = 0x1505
+	LF_UNION     TypeLeafKind = 0x1506
+	LF_ENUM      TypeLeafKind = 0x1507
+	LF_MEMBER    TypeLeafKind = 0x150d
+	LF_FUNC_ID   TypeLeafKind = 0x1601
+	LF_MFUNC_ID  TypeLeafKind = 0x1602
+)
+
+// Numeric leaf tags, used to encode the width of a numeric value (e.g. a
+// member offset or an enumerate value) that follows.
+//
+// ref: LEAF_ENUM_e (LF_CHAR .. LF_UQUADWORD)
+const (
+	lfChar      = 0x8000
+	lfShort     = 0x8001
+	lfUShort    = 0x8002
+	lfLong      = 0x8003
+	lfULong     = 0x8004
+	lfQuadword  = 0x8009
+	lfUQuadword = 0x800a
+)
+
+// TypeIndex is a reference to another type (or ID) record, by its index into
+// the TPI (or IPI) stream.
+type TypeIndex uint32
+
+// TPIStreamHeader is the header of the TPI and IPI streams.
+//
+// ref: https://llvm.org/docs/PDB/TpiStream.html#stream-header
+// ref: HDR
+type TPIStreamHeader struct {
+	// Stream version.
+	Version int32
+	// Size in bytes of this header.
+	HeaderSize int32
+	// Lowest type index used by the type record array (typically 0x1000).
+	TypeIndexBegin uint32
+	// One past the highest type index used by the type record array.
+	TypeIndexEnd uint32
+	// Size in bytes of the type record array that follows the header.
+	TypeRecordBytes uint32
+	// Stream number of the hash stream, or 0xFFFF if not present.
+	HashStreamIndex uint16
+	// Stream number of the auxiliary hash stream, or 0xFFFF if not present.
+	HashAuxStreamIndex uint16
+	// Size in bytes of a single hash value.
+	HashKeySize uint32
+	// Number of buckets used by the incremental linking hash table.
+	NumHashBuckets uint32
+	// Offset and length of the hash value buffer, relative to the start of
+	// the hash stream.
+	HashValueBufferOffset int32
+	HashValueBufferLength int32
+	// Offset and length of the type index offset buffer.
+	IndexOffsetBufferOffset int32
+	IndexOffsetBufferLength int32
+	// Offset and length of the incremental-linking hash adjustment buffer.
+	HashAdjBufferOffset int32
+	HashAdjBufferLength int32
+}
+
+// PointerType is the decoded representation of an LF_POINTER record.
+type PointerType struct {
+	// Type pointed to.
+	Referent TypeIndex
+	// Pointer attributes (kind, mode, size, flags).
+	Attrs uint32
+}
+
+// parsePointerType parses an LF_POINTER record, reading from r.
+func parsePointerType(r *bytes.Reader) (*PointerType, error) {
+	t := &PointerType{}
+	if err := binary.Read(r, binary.LittleEndian, &t.Referent); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &t.Attrs); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return t, nil
+}
+
+// ProcedureType is the decoded representation of an LF_PROCEDURE record.
+type ProcedureType struct {
+	// Return value type.
+	ReturnType TypeIndex
+	// Calling convention.
+	CallConv uint8
+	// Function attributes.
+	FuncAttrs uint8
+	// Number of parameters.
+	NumParams uint16
+	// Type index of the argument list (an LF_ARGLIST record).
+	ArgList TypeIndex
+}
+
+// parseProcedureType parses an LF_PROCEDURE record, reading from r.
+func parseProcedureType(r *bytes.Reader) (*ProcedureType, error) {
+	t := &ProcedureType{}
+	if err := binary.Read(r, binary.LittleEndian, &t.ReturnType); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &t.CallConv); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &t.FuncAttrs); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &t.NumParams); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &t.ArgList); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return t, nil
+}
+
+// ArgListType is the decoded representation of an LF_ARGLIST record.
+type ArgListType struct {
+	// Type indices of the argument types, in order.
+	Args []TypeIndex
+}
+
+// parseArgListType parses an LF_ARGLIST record, reading from r.
+func parseArgListType(r *bytes.Reader) (*ArgListType, error) {
+	var n uint32
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	t := &ArgListType{
+		Args: make([]TypeIndex, n),
+	}
+	if err := binary.Read(r, binary.LittleEndian, &t.Args); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return t, nil
+}
+
+// StructType is the decoded representation of an LF_STRUCTURE, LF_CLASS, or
+// LF_UNION record.
+type StructType struct {
+	// Record kind (LF_STRUCTURE, LF_CLASS, or LF_UNION).
+	Kind TypeLeafKind
+	// Number of members, as declared in the associated LF_FIELDLIST record.
+	Count uint16
+	// Type properties (packed, forward reference, scoped, etc.).
+	Properties uint16
+	// Type index of the associated LF_FIELDLIST record, or 0 if forward
+	// declared.
+	FieldList TypeIndex
+	// Type index of the base class list (LF_CLASS/LF_STRUCTURE only).
+	DerivedFrom TypeIndex
+	// Type index of the vtable shape (LF_CLASS/LF_STRUCTURE only).
+	VShape TypeIndex
+	// Size in bytes of an instance of the type.
+	Size uint64
+	// Name of the type.
+	Name string
+}
+
+// parseStructType parses an LF_STRUCTURE, LF_CLASS, or LF_UNION record,
+// reading from r. hasVTable reports whether the record carries the
+// DerivedFrom/VShape fields (true for LF_STRUCTURE/LF_CLASS, false for
+// LF_UNION).
+func parseStructType(kind TypeLeafKind, r *bytes.Reader, hasVTable bool) (*StructType, error) {
+	t := &StructType{
+		Kind: kind,
+	}
+	if err := binary.Read(r, binary.LittleEndian, &t.Count); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &t.Properties); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &t.FieldList); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if hasVTable {
+		if err := binary.Read(r, binary.LittleEndian, &t.DerivedFrom); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &t.VShape); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	size, err := readNumericLeaf(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	t.Size = size
+	name, err := readCString(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	t.Name = name
+	return t, nil
+}
+
+// EnumType is the decoded representation of an LF_ENUM record.
+type EnumType struct {
+	// Number of enumerators, as declared in the associated LF_FIELDLIST
+	// record.
+	Count uint16
+	// Type properties.
+	Properties uint16
+	// Underlying (storage) type of the enum.
+	UnderlyingType TypeIndex
+	// Type index of the associated LF_FIELDLIST record.
+	FieldList TypeIndex
+	// Name of the type.
+	Name string
+}
+
+// parseEnumType parses an LF_ENUM record, reading from r.
+func parseEnumType(r *bytes.Reader) (*EnumType, error) {
+	t := &EnumType{}
+	if err := binary.Read(r, binary.LittleEndian, &t.Count); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &t.Properties); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &t.UnderlyingType); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &t.FieldList); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	name, err := readCString(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	t.Name = name
+	return t, nil
+}
+
+// ArrayType is the decoded representation of an LF_ARRAY record.
+type ArrayType struct {
+	// Type of each element.
+	ElementType TypeIndex
+	// Type of the array index.
+	IndexType TypeIndex
+	// Size in bytes of the array.
+	Size uint64
+	// Name of the type.
+	Name string
+}
+
+// parseArrayType parses an LF_ARRAY record, reading from r.
+func parseArrayType(r *bytes.Reader) (*ArrayType, error) {
+	t := &ArrayType{}
+	if err := binary.Read(r, binary.LittleEndian, &t.ElementType); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &t.IndexType); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	size, err := readNumericLeaf(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	t.Size = size
+	name, err := readCString(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	t.Name = name
+	return t, nil
+}
+
+// ModifierType is the decoded representation of an LF_MODIFIER record.
+type ModifierType struct {
+	// Type being modified.
+	ModifiedType TypeIndex
+	// Modifiers (const, volatile, unaligned).
+	Modifiers uint16
+}
+
+// parseModifierType parses an LF_MODIFIER record, reading from r.
+func parseModifierType(r *bytes.Reader) (*ModifierType, error) {
+	t := &ModifierType{}
+	if err := binary.Read(r, binary.LittleEndian, &t.ModifiedType); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &t.Modifiers); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return t, nil
+}
+
+// MemberRecord is a decoded LF_MEMBER sub-record of an LF_FIELDLIST record.
+type MemberRecord struct {
+	Attrs  uint16
+	Type   TypeIndex
+	Offset uint64
+	Name   string
+}
+
+// EnumerateRecord is a decoded LF_ENUMERATE sub-record of an LF_FIELDLIST
+// record.
+type EnumerateRecord struct {
+	Attrs uint16
+	Value uint64
+	Name  string
+}
+
+// BClassRecord is a decoded LF_BCLASS sub-record of an LF_FIELDLIST record.
+type BClassRecord struct {
+	Attrs    uint16
+	BaseType TypeIndex
+	Offset   uint64
+}
+
+// FieldListType is the decoded representation of an LF_FIELDLIST record, a
+// container of member, enumerate, and base class sub-records.
+type FieldListType struct {
+	Members     []MemberRecord
+	Enumerates  []EnumerateRecord
+	BaseClasses []BClassRecord
+}
+
+// parseFieldListType parses an LF_FIELDLIST record, reading from r.
+func parseFieldListType(r *bytes.Reader) (*FieldListType, error) {
+	t := &FieldListType{}
+	for r.Len() > 0 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		// Sub-records are padded to 4-byte alignment using LF_PAD0..LF_PAD15
+		// (0xF0..0xFF) bytes; the low nibble is the total number of padding
+		// bytes, including this one.
+		if b >= 0xf0 {
+			if n := int(b & 0x0f); n > 1 {
+				if _, err := r.Seek(int64(n-1), io.SeekCurrent); err != nil {
+					return nil, errors.WithStack(err)
+				}
+			}
+			continue
+		}
+		if err := r.UnreadByte(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		var kind TypeLeafKind
+		if err := binary.Read(r, binary.LittleEndian, &kind); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		switch kind {
+		case LF_MEMBER:
+			member := MemberRecord{}
+			if err := binary.Read(r, binary.LittleEndian, &member.Attrs); err != nil {
+				return nil, errors.WithStack(err)
+			}
+			if err := binary.Read(r, binary.LittleEndian, &member.Type); err != nil {
+				return nil, errors.WithStack(err)
+			}
+			offset, err := readNumericLeaf(r)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			member.Offset = offset
+			name, err := readCString(r)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			member.Name = name
+			t.Members = append(t.Members, member)
+		case LF_ENUMERATE:
+			enumerate := EnumerateRecord{}
+			if err := binary.Read(r, binary.LittleEndian, &enumerate.Attrs); err != nil {
+				return nil, errors.WithStack(err)
+			}
+			value, err := readNumericLeaf(r)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			enumerate.Value = value
+			name, err := readCString(r)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			enumerate.Name = name
+			t.Enumerates = append(t.Enumerates, enumerate)
+		case LF_BCLASS:
+			bclass := BClassRecord{}
+			if err := binary.Read(r, binary.LittleEndian, &bclass.Attrs); err != nil {
+				return nil, errors.WithStack(err)
+			}
+			if err := binary.Read(r, binary.LittleEndian, &bclass.BaseType); err != nil {
+				return nil, errors.WithStack(err)
+			}
+			offset, err := readNumericLeaf(r)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			bclass.Offset = offset
+			t.BaseClasses = append(t.BaseClasses, bclass)
+		default:
+			// TODO: decode remaining LF_FIELDLIST sub-record kinds
+			// (LF_VFUNCTAB, LF_METHOD, LF_NESTTYPE, ...).
+			//
+			// Sub-records aren't length-prefixed, so an unsupported kind
+			// can't be skipped over; stop decoding here, but warn so
+			// callers don't mistake the resulting FieldListType for a
+			// complete member list.
+			warn.Printf("failed to decode field list sub-record %#04x: not yet implemented", kind)
+			return t, nil
+		}
+	}
+	return t, nil
+}
+
+// FuncIDType is the decoded representation of an LF_FUNC_ID or LF_MFUNC_ID
+// record, used by the IPI stream.
+type FuncIDType struct {
+	// Record kind (LF_FUNC_ID or LF_MFUNC_ID).
+	Kind TypeLeafKind
+	// Enclosing scope or class; 0 for LF_FUNC_ID with no enclosing scope.
+	Parent TypeIndex
+	// Type index of the function's LF_PROCEDURE (or LF_MFUNCTION) record.
+	FunctionType TypeIndex
+	// Name of the function.
+	Name string
+}
+
+// parseFuncIDType parses an LF_FUNC_ID or LF_MFUNC_ID record, reading from r.
+func parseFuncIDType(kind TypeLeafKind, r *bytes.Reader) (*FuncIDType, error) {
+	t := &FuncIDType{
+		Kind: kind,
+	}
+	if err := binary.Read(r, binary.LittleEndian, &t.Parent); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &t.FunctionType); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	name, err := readCString(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	t.Name = name
+	return t, nil
+}
+
+// readNumericLeaf reads a CodeView numeric leaf from r: values below 0x8000
+// are encoded directly as a uint16; values at or above 0x8000 are tagged with
+// a width indicator (LF_CHAR, LF_SHORT, LF_USHORT, LF_LONG, LF_ULONG,
+// LF_QUADWORD, or LF_UQUADWORD) followed by the value itself.
+func readNumericLeaf(r *bytes.Reader) (uint64, error) {
+	var tag uint16
+	if err := binary.Read(r, binary.LittleEndian, &tag); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if tag < 0x8000 {
+		return uint64(tag), nil
+	}
+	switch tag {
+	case lfChar:
+		var v int8
+		if err := binary.Read(r, binary.LittleEndian, &v); err != nil {
+			return 0, errors.WithStack(err)
+		}
+		return uint64(v), nil
+	case lfShort:
+		var v int16
+		if err := binary.Read(r, binary.LittleEndian, &v); err != nil {
+			return 0, errors.WithStack(err)
+		}
+		return uint64(v), nil
+	case lfUShort:
+		var v uint16
+		if err := binary.Read(r, binary.LittleEndian, &v); err != nil {
+			return 0, errors.WithStack(err)
+		}
+		return uint64(v), nil
+	case lfLong:
+		var v int32
+		if err := binary.Read(r, binary.LittleEndian, &v); err != nil {
+			return 0, errors.WithStack(err)
+		}
+		return uint64(v), nil
+	case lfULong:
+		var v uint32
+		if err := binary.Read(r, binary.LittleEndian, &v); err != nil {
+			return 0, errors.WithStack(err)
+		}
+		return uint64(v), nil
+	case lfQuadword:
+		var v int64
+		if err := binary.Read(r, binary.LittleEndian, &v); err != nil {
+			return 0, errors.WithStack(err)
+		}
+		return uint64(v), nil
+	case lfUQuadword:
+		var v uint64
+		if err := binary.Read(r, binary.LittleEndian, &v); err != nil {
+			return 0, errors.WithStack(err)
+		}
+		return v, nil
+	default:
+		return 0, errors.Errorf("unsupported numeric leaf tag %#04x", tag)
+	}
+}
+
+// TypeRecord is a single decoded entry of the TPI or IPI stream's type record
+// array.
+type TypeRecord struct {
+	// Record kind.
+	Kind TypeLeafKind
+	// Raw record body, excluding the leading 2-byte Kind field.
+	Data []byte
+	// Decoded representation of the record (e.g. *PointerType,
+	// *StructType), or nil if Kind is not yet supported.
+	Leaf interface{}
+}
+
+// decodeTypeRecord decodes the body of a type record of the given kind,
+// reading from r.
+func decodeTypeRecord(kind TypeLeafKind, r *bytes.Reader) (interface{}, error) {
+	switch kind {
+	case LF_POINTER:
+		return parsePointerType(r)
+	case LF_PROCEDURE:
+		return parseProcedureType(r)
+	case LF_ARGLIST:
+		return parseArgListType(r)
+	case LF_STRUCTURE, LF_CLASS:
+		return parseStructType(kind, r, true)
+	case LF_UNION:
+		return parseStructType(kind, r, false)
+	case LF_ENUM:
+		return parseEnumType(r)
+	case LF_ARRAY:
+		return parseArrayType(r)
+	case LF_MODIFIER:
+		return parseModifierType(r)
+	case LF_FIELDLIST:
+		return parseFieldListType(r)
+	case LF_FUNC_ID, LF_MFUNC_ID:
+		return parseFuncIDType(kind, r)
+	default:
+		return nil, errors.Errorf("unsupported type record kind %#04x", kind)
+	}
+}
+
+// TPIStream is the TPI (type manager) or IPI (ID manager) stream of a PDB
+// file. Types are stored in an array indexed from Header.TypeIndexBegin.
+//
+// ref: https://llvm.org/docs/PDB/TpiStream.html
+type TPIStream struct {
+	// Stream header.
+	Header *TPIStreamHeader
+	// Type records, indexed from Header.TypeIndexBegin.
+	Types []TypeRecord
+}
+
+// Lookup returns the type record with the given type index, or the zero
+// value TypeRecord if idx is out of range.
+func (tpi *TPIStream) Lookup(idx uint32) TypeRecord {
+	i := int(idx) - int(tpi.Header.TypeIndexBegin)
+	if i < 0 || i >= len(tpi.Types) {
+		return TypeRecord{}
+	}
+	return tpi.Types[i]
+}
+
+// parseTPIStream parses a TPI or IPI stream, reading from r.
+func (file *File) parseTPIStream(r io.Reader) (*TPIStream, error) {
+	hdr := &TPIStreamHeader{}
+	if err := binary.Read(r, binary.LittleEndian, hdr); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	tpi := &TPIStream{
+		Header: hdr,
+	}
+	typeRecordData := make([]byte, hdr.TypeRecordBytes)
+	if _, err := io.ReadFull(r, typeRecordData); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	tr := bytes.NewReader(typeRecordData)
+	for tr.Len() > 0 {
+		var length uint16
+		if err := binary.Read(tr, binary.LittleEndian, &length); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(tr, body); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		br := bytes.NewReader(body)
+		var kind uint16
+		if err := binary.Read(br, binary.LittleEndian, &kind); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		rec := TypeRecord{
+			Kind: TypeLeafKind(kind),
+			Data: body[2:],
+		}
+		leaf, err := decodeTypeRecord(rec.Kind, bytes.NewReader(rec.Data))
+		if err != nil {
+			warn.Printf("failed to decode type record %#04x: %v", kind, err)
+		} else {
+			rec.Leaf = leaf
+		}
+		tpi.Types = append(tpi.Types, rec)
+	}
+	return tpi, nil
+}
@@ -0,0 +1,40 @@
+package pdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// TestParseFieldListTypeWarnsOnUnsupportedSubRecord verifies that an
+// unsupported LF_FIELDLIST sub-record kind (sub-records aren't
+// length-prefixed, so decoding can't skip past it) at least warns, rather
+// than silently returning a FieldListType that looks complete.
+func TestParseFieldListTypeWarnsOnUnsupportedSubRecord(t *testing.T) {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, LF_MEMBER)
+	binary.Write(buf, binary.LittleEndian, uint16(3))      // Attrs
+	binary.Write(buf, binary.LittleEndian, uint32(0x1020)) // Type
+	binary.Write(buf, binary.LittleEndian, uint16(0))      // Offset (numeric literal)
+	buf.WriteString("first\x00")
+
+	// LF_METHOD (0x150f): unsupported, with a placeholder body.
+	binary.Write(buf, binary.LittleEndian, uint16(0x150f))
+	buf.Write([]byte{0, 0, 0, 0})
+
+	var log bytes.Buffer
+	prev := warn.Writer()
+	warn.SetOutput(&log)
+	defer warn.SetOutput(prev)
+
+	fl, err := parseFieldListType(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("parseFieldListType returned error: %v", err)
+	}
+	if len(fl.Members) != 1 {
+		t.Fatalf("len(fl.Members) = %d; want 1 (truncated at the unsupported sub-record)", len(fl.Members))
+	}
+	if log.Len() == 0 {
+		t.Error("parseFieldListType truncated on an unsupported sub-record without warning")
+	}
+}